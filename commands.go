@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"lib"
+)
+
+// redundant lists the redundant dependencies and removes them, if requested
+func (set *setup) redundant() error {
+	if !argRedundantRemove.Get() {
+		for _, e := range lib.RedundantEdges(set.store) {
+			fmt.Fprintf(os.Stdout, "%s -> %s\n", e.From, e.To)
+		}
+		return nil
+	}
+
+	removed := lib.RemoveRedundantEdges(set.store)
+	for _, e := range removed {
+		fmt.Fprintf(os.Stdout, "removed %s -> %s\n", e.From, e.To)
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+	return set.store.Save()
+}
+
+// format rewrites the data file in its canonical form
+func (set *setup) format() error {
+	return set.store.Save()
+}
+
+// warnProblems prints the integrity problems of the data file as warnings
+func (set *setup) warnProblems() {
+	problems := lib.Check(set.store)
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", p)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "run prioritize check --fix to fix them\n")
+	}
+}
+
+// check prints the integrity problems of the data file and fixes them, if requested
+func (set *setup) check() error {
+	if argCheckFix.Get() {
+		fixed := lib.Fix(set.store)
+		for _, p := range fixed {
+			if p.Fixable {
+				fmt.Fprintf(os.Stdout, "fixed %s\n", p)
+			}
+		}
+		if err := set.store.Save(); err != nil {
+			return err
+		}
+	}
+
+	problems := lib.Check(set.store)
+	for _, p := range problems {
+		fmt.Fprintf(os.Stdout, "%s\n", p)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems", len(problems))
+	}
+	return nil
+}
+
+// report writes the priority report in the requested format
+func (set *setup) report() error {
+	w := os.Stdout
+	if out := argReportOut.Get(); out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	r := lib.NewReport(set.store, set.App, time.Now())
+	switch format := argReportFormat.Get(); format {
+	case "md":
+		return r.WriteMarkdown(w)
+	case "html":
+		return r.WriteHTML(w)
+	default:
+		return fmt.Errorf("unknown report format %#v", format)
+	}
+}
+
+// mermaid writes the item or tag graph as Mermaid flowchart
+func (set *setup) mermaid() error {
+	fn := lib.MermaidItems
+	if argMermaidTags.Get() {
+		fn = lib.MermaidTags
+	}
+
+	m, err := fn(set.store, lib.VisOptions{Rank: set.Ranker})
+	if err != nil {
+		return err
+	}
+	return writeOut(argMermaidOut.Get(), []byte(m))
+}
+
+// render writes the item graph as SVG image
+func (set *setup) render() error {
+	opts := lib.VisOptions{Rank: set.Ranker}
+
+	if attr := argRenderAttr.Get(); attr != "" {
+		attrs, err := lib.ParseAttributeFilter(strings.Split(attr, ","))
+		if err != nil {
+			return err
+		}
+		opts.Filter = lib.MatchAttributes(attrs)
+	}
+
+	svg, err := lib.ItemsSVG(set.store, opts)
+	if err != nil {
+		return err
+	}
+	return writeOut(argRenderOut.Get(), svg)
+}
+
+// export writes the data store in the requested format
+func (set *setup) export() error {
+	f, err := lib.GetFormat(argExportFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if lf, ok := f.(lib.LossyFormat); ok {
+		var unmapped []string
+		data, unmapped, err = lf.MarshalLossy(set.store)
+		reportUnmapped(unmapped)
+	} else {
+		data, err = f.Marshal(set.store)
+	}
+	if err != nil {
+		return err
+	}
+	return writeOut(argExportOut.Get(), data)
+}
+
+// importFile replaces the data store by the content of the imported file or merges it into the data store,
+// see lib.Import
+func (set *setup) importFile() error {
+	path := argImportIn.Get()
+	name := argImportFormat.Get()
+	if name == lib.FormatMarkdown || name == "" && strings.EqualFold(filepath.Ext(path), ".md") {
+		return set.importMarkdown(path)
+	}
+
+	f := lib.FormatFor(path)
+	if f == nil && name == "" {
+		name = lib.FormatJSON
+	}
+	if name != "" {
+		var err error
+		if f, err = lib.GetFormat(name); err != nil {
+			return err
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	unmapped, err := lib.Import(set.store, f, data)
+	if err != nil {
+		return fmt.Errorf("can't import %s: %s", path, err)
+	}
+	reportUnmapped(unmapped)
+	return set.store.Save()
+}
+
+// importMarkdown adds the checklist items of the Markdown file to the data store
+func (set *setup) importMarkdown(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	added := lib.ImportMarkdown(data, set.store)
+	fmt.Printf("%d new items\n", len(added))
+	return set.store.Save()
+}
+
+// scan adds the TODO comments of the scanned directory to the data store
+func (set *setup) scan() error {
+	todos, err := lib.ScanTODOs(argScanDir.Get())
+	if err != nil {
+		return err
+	}
+	added := lib.AddTODOs(set.store, todos)
+	for _, name := range added {
+		fmt.Printf("new: %s\n", name)
+	}
+	fmt.Printf("%d TODO comments, %d new items\n", len(todos), len(added))
+	return set.store.Save()
+}
+
+// run executes the commands of the goal and its dependencies, saving the data store after each finished item
+func (set *setup) run() error {
+	res, err := lib.Run(set.store, lib.RunOptions{
+		Goal:     argRunGoal.Get(),
+		Parallel: int(argRunParallel.Get()),
+		Dir:      set.Wd,
+		Log:      os.Stdout,
+		LogDir:   argRunLogDir.Get(),
+		OnDone: func(*lib.Item) {
+			if err := set.store.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "can't save: %s\n", err)
+			}
+		},
+	})
+	if res != nil {
+		fmt.Printf("%d done, %d skipped, %d failed, %d not run\n", len(res.Done), len(res.Skipped), len(res.Failed), len(res.Blocked))
+	}
+	return err
+}
+
+// reportUnmapped prints what a format could not map to stderr
+func reportUnmapped(unmapped []string) {
+	for _, msg := range unmapped {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", msg)
+	}
+}
+
+// writeOut writes the data to the file at path or to stdout, if path is empty
+func writeOut(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// fileFormat returns the format of the given name or, if the name is empty, the format for the extension of path
+func fileFormat(path, name string) (lib.Format, error) {
+	switch name {
+	case "":
+		return lib.FormatFor(path), nil
+	case lib.FormatJSON:
+		return nil, nil
+	default:
+		return lib.GetFormat(name)
+	}
+}
+
+// loadFile loads the store from the data file at the given path in the given format, see fileFormat
+func loadFile(path, format string) (*lib.JSONStore, error) {
+	ff, err := fileFormat(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store := lib.NewJSONStore()
+	store.Reader = f
+	store.Format = ff
+	if err := store.Load(); err != nil {
+		return nil, fmt.Errorf("can't load %s: %s", path, err)
+	}
+	store.Reader = nil
+	return store, nil
+}
+
+// diff prints the semantic difference between the old and the new data file
+func diff() error {
+	from, err := loadFile(argDiffOld.Get(), argDiffFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	to, err := loadFile(argDiffNew.Get(), argDiffFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	d := lib.DiffStores(from, to)
+	if argDiffJSON.Get() {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	return d.WriteText(os.Stdout)
+}
+
+// mergeDriver merges the data files of base, ours and theirs and writes the result to ours in its format.
+// It fails, if there are conflicts, so that git reports them.
+func mergeDriver() error {
+	base, err := loadFile(argMergeBase.Get(), argMergeFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	ours, err := loadFile(argMergeOurs.Get(), argMergeFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	theirs, err := loadFile(argMergeTheirs.Get(), argMergeFormat.Get())
+	if err != nil {
+		return err
+	}
+
+	merged, conflicts := lib.MergeStores(base, ours, theirs)
+
+	f, err := os.Create(argMergeOurs.Get())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	merged.Writer = f
+	merged.Format = ours.Format
+	if err := merged.Save(); err != nil {
+		return err
+	}
+
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "CONFLICT: %s\n", c)
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%d conflicts", len(conflicts))
+	}
+	return nil
+}
@@ -18,13 +18,63 @@ var (
 	args     = config.MustNew("prioritize", "0.1", "a webbased tool to help you prioritize based on dependencies")
 	argPort  = args.NewInt32("port", "port on which the webserver runs", config.Default(int32(8080)), config.Shortflag('p'))
 	argHost  = args.NewString("host", "hostname or ip address of the webserver", config.Default("localhost"), config.Shortflag('h'))
-	argFile  = args.NewString("file", "file that acts as data store (json)", config.Default("prioritize.json"), config.Shortflag('f'))
+	argFile  = args.NewString("file", "file that acts as data store, the format is chosen by the extension ("+strings.Join(lib.FormatNames(), ", ")+")", config.Default("prioritize.json"), config.Shortflag('f'))
 	argDebug = args.NewBool("debug", "turn on debugging", config.Default(false))
+	argRank  = args.NewString("rank", "default ranker ("+strings.Join(lib.RankerNames(), ", ")+"), overrides the default of the project", config.Shortflag('r'))
+
+	cmdRedundant       = args.MustCommand("redundant", "lists the dependencies that are implied by other dependencies").Skip("port").Skip("host")
+	argRedundantRemove = cmdRedundant.NewBool("remove", "removes the redundant dependencies", config.Default(false))
+
+	cmdFmt = args.MustCommand("fmt", "writes the data file in its canonical form").Skip("port").Skip("host")
+
+	cmdCheck    = args.MustCommand("check", "checks the references of the data file").Skip("port").Skip("host")
+	argCheckFix = cmdCheck.NewBool("fix", "fixes the problems that can be fixed automatically", config.Default(false))
+
+	cmdReport       = args.MustCommand("report", "writes the priority report").Skip("port").Skip("host")
+	argReportFormat = cmdReport.NewString("format", "format of the report (md, html)", config.Default("md"))
+	argReportOut    = cmdReport.NewString("out", "file to write the report to, default: stdout", config.Shortflag('o'))
+
+	cmdMermaid     = args.MustCommand("mermaid", "writes the dependency graph as Mermaid flowchart").Skip("port").Skip("host")
+	argMermaidTags = cmdMermaid.NewBool("tags", "writes the tag graph instead of the item graph", config.Default(false))
+	argMermaidOut  = cmdMermaid.NewString("out", "file to write the flowchart to, default: stdout", config.Shortflag('o'))
+
+	cmdRender     = args.MustCommand("render", "renders the item graph as SVG image").Skip("port").Skip("host")
+	argRenderOut  = cmdRender.NewString("out", "file to write the image to, default: stdout", config.Shortflag('o'))
+	argRenderAttr = cmdRender.NewString("attr", "only renders items with the given attributes (key:value, separated by commas)")
+
+	cmdExport       = args.MustCommand("export", "writes the data store in another format").Skip("port").Skip("host")
+	argExportFormat = cmdExport.NewString("format", "format of the export ("+strings.Join(lib.FormatNames(), ", ")+")", config.Required)
+	argExportOut    = cmdExport.NewString("out", "file to write the export to, default: stdout", config.Shortflag('o'))
+
+	cmdImport       = args.MustCommand("import", "imports a file: "+lib.FormatTaskwarrior+" tasks and "+lib.FormatMarkdown+" checklists are merged into the data store, all other formats replace it").Skip("port").Skip("host")
+	argImportFormat = cmdImport.NewString("format", "format of the imported file ("+strings.Join(lib.FormatNames(), ", ")+", "+lib.FormatMarkdown+"), default: chosen by the extension")
+	argImportIn     = cmdImport.NewString("in", "the file to import", config.Required)
+
+	cmdScan    = args.MustCommand("scan", "adds the TODO(tag): text comments of the files in a directory as items").Skip("port").Skip("host")
+	argScanDir = cmdScan.NewString("dir", "the directory to scan", config.Default("."))
+
+	cmdRun         = args.MustCommand("run", "runs the commands of the items in dependency order and marks them as done").Skip("port").Skip("host")
+	argRunGoal     = cmdRun.NewString("goal", "the item to reach, default: all items")
+	argRunParallel = cmdRun.NewInt32("parallel", "number of commands that run at the same time", config.Default(int32(1)))
+	argRunLogDir   = cmdRun.NewString("logdir", "directory for a log file per item (name-hash.log)")
+
+	cmdDiff       = args.MustCommand("diff", "shows the semantic difference between two data files").Skip("port").Skip("host").Skip("file")
+	argDiffOld    = cmdDiff.NewString("old", "the old data file", config.Required)
+	argDiffNew    = cmdDiff.NewString("new", "the new data file", config.Required)
+	argDiffJSON   = cmdDiff.NewBool("json", "prints the difference as json", config.Default(false))
+	argDiffFormat = cmdDiff.NewString("format", "format of the data files ("+strings.Join(lib.FormatNames(), ", ")+"), default: chosen by the extension")
+
+	cmdMergeDriver = args.MustCommand("mergedriver", "3-way merge of data files for git, the result is written to the file of ours").Skip("port").Skip("host").Skip("file")
+	argMergeBase   = cmdMergeDriver.NewString("base", "the data file of the common ancestor (%O)", config.Required)
+	argMergeOurs   = cmdMergeDriver.NewString("ours", "the data file of the current branch (%A)", config.Required)
+	argMergeTheirs = cmdMergeDriver.NewString("theirs", "the data file of the other branch (%B)", config.Required)
+	argMergeFormat = cmdMergeDriver.NewString("format", "format of the data files ("+strings.Join(lib.FormatNames(), ", ")+"), default: chosen by the extension (the temporary files of git have none)")
 )
 
 type setup struct {
 	Host         string
 	Port         int
+	Ranker       string
 	Wd           string
 	SelfBinName  string
 	App          string
@@ -51,27 +101,39 @@ steps:
 		case 1:
 			set.Port = int(argPort.Get())
 			set.Host = argHost.Get()
-			set.Wd, err = os.Getwd()
+			set.Ranker = argRank.Get()
+			_, err = lib.GetRanker(set.Ranker)
 		case 2:
+			set.Wd, err = os.Getwd()
+		case 3:
 			set.SelfBinName = os.Args[0]
 			_, err = os.Stat(set.SelfBinName)
 			if err != nil && os.IsNotExist(err) {
 				set.SelfBinName, err = which(set.SelfBinName)
 			}
-		case 3:
-			set.zfs, err = zgok.RestoreFileSystem(set.SelfBinName)
 		case 4:
+			// the static files are only needed by the webserver
+			if args.ActiveCommand() == nil {
+				set.zfs, err = zgok.RestoreFileSystem(set.SelfBinName)
+			}
+		case 5:
+			// commands that work on other files don't need the data store
+			if cmd := args.ActiveCommand(); cmd == cmdDiff || cmd == cmdMergeDriver {
+				break steps
+			}
 			fpath := filepath.Join(set.Wd, argFile.Get())
 			set.file, err = os.OpenFile(fpath, os.O_RDWR, 0644)
 			if err != nil && os.IsNotExist(err) {
 				set.CreatingFile = true
 				set.file, err = os.Create(fpath)
 			}
-		case 5:
+		case 6:
 			defer set.file.Close()
 			set.store = lib.NewJSONStore()
 			set.store.Reader = set.file
 			set.store.Writer = set.file
+			set.store.Format = lib.FormatFor(set.file.Name())
+			set.store.History = lib.NewDirHistory(set.file.Name())
 			if !set.CreatingFile {
 				err = set.store.Load()
 			} else {
@@ -88,12 +150,43 @@ steps:
 		}
 	}
 
+	if err == nil {
+		switch args.ActiveCommand() {
+		case nil:
+			set.warnProblems()
+			set.serve()
+		case cmdRedundant:
+			err = set.redundant()
+		case cmdFmt:
+			err = set.format()
+		case cmdCheck:
+			err = set.check()
+		case cmdReport:
+			err = set.report()
+		case cmdMermaid:
+			err = set.mermaid()
+		case cmdRender:
+			err = set.render()
+		case cmdExport:
+			err = set.export()
+		case cmdImport:
+			err = set.importFile()
+		case cmdScan:
+			err = set.scan()
+		case cmdRun:
+			err = set.run()
+		case cmdDiff:
+			err = diff()
+		case cmdMergeDriver:
+			err = mergeDriver()
+		}
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
 		os.Exit(1)
 	}
 
-	set.serve()
 	os.Exit(0)
 }
 
@@ -116,6 +209,8 @@ func which(name string) (string, error) {
 
 func (set *setup) serve() {
 	server := webserver.NewStoreServer(set.App, set.store)
+	server.SetDefaultRanker(set.Ranker)
+	server.SetHistory(set.store.History)
 
 	// assetServer := zfs.FileServer("static")
 	http.Handle("/static/", http.StripPrefix("/static/", set.zfs.FileServer("static")))
@@ -127,13 +222,39 @@ func (set *setup) serve() {
 	// http.HandleFunc("/tag/tree", server.TagTree)
 	// http.HandleFunc("/item/all", server.AllItems)
 	http.HandleFunc("/item/vis", server.ItemsVisDataSet)
+	http.HandleFunc("/item/legend", server.ItemsLegend)
+	http.HandleFunc("/item/ranking", server.ItemRanking)
+	http.HandleFunc("/item/schedule", server.ItemSchedule)
+	http.HandleFunc("/project/schema", server.Schema)
+	http.HandleFunc("/project", server.Project)
+	http.HandleFunc("/rankers", server.Rankers)
+	http.HandleFunc("/history", server.History)
+	http.HandleFunc("/history/diff", server.HistoryDiff)
+	http.HandleFunc("/export", server.Export)
+	http.HandleFunc("/import", server.Import)
+	http.HandleFunc("/report.md", server.ReportMarkdown)
+	http.HandleFunc("/report.html", server.ReportHTML)
 	http.HandleFunc("/item/rename", server.RenameItem)
 	http.HandleFunc("/item/remove", server.RemoveItem)
+	http.HandleFunc("/item/impact", server.ItemImpact)
+	http.HandleFunc("/item/merge", server.MergeItems)
+	http.HandleFunc("/item/split", server.SplitItem)
+	http.HandleFunc("/item/move", server.MoveItem)
+	http.HandleFunc("/item/rollup", server.ItemRollup)
+	http.HandleFunc("/item/mermaid", server.ItemsMermaid)
+	http.HandleFunc("/item/graph.svg", server.ItemsSVG)
+	http.HandleFunc("/item/redundant-edges", server.RedundantEdges)
 	http.HandleFunc("/item/remove-edge", server.RemoveItemEdge)
 	// http.HandleFunc("/tag/all", server.AllTags)
 	http.HandleFunc("/item/put", server.PutItem)
 	http.HandleFunc("/item/put-edge", server.PutItemEdge)
-	// http.HandleFunc("/tag/put", server.PutTag)
+	http.HandleFunc("/tag/vis", server.TagsVisDataSet)
+	http.HandleFunc("/tag/mermaid", server.TagsMermaid)
+	http.HandleFunc("/tag/put", server.PutTag)
+	http.HandleFunc("/tag/put-edge", server.PutTagEdge)
+	http.HandleFunc("/tag/rename", server.RenameTag)
+	http.HandleFunc("/tag/remove", server.RemoveTag)
+	http.HandleFunc("/tag/remove-edge", server.RemoveTagEdge)
 	http.HandleFunc("/", serveIndex)
 
 	hoststr := fmt.Sprintf("%s:%d", set.Host, set.Port)
@@ -170,10 +291,58 @@ var indexPage = []byte(`<!doctype html>
       height: 100%;
       background-color: gray;
     }
+
+    #legend {
+      position: absolute;
+      right: 10px;
+      bottom: 10px;
+      font-family: sans-serif;
+      font-size: 12px;
+    }
+
+    .legend-entry {
+      padding: 2px 6px;
+      margin-top: 2px;
+    }
+
+    #toolbar {
+      position: absolute;
+      right: 10px;
+      top: 10px;
+    }
+
+    #history {
+      position: absolute;
+      left: 10px;
+      top: 10px;
+      font-family: sans-serif;
+      font-size: 12px;
+    }
+
+    #breadcrumb {
+      position: absolute;
+      left: 10px;
+      bottom: 10px;
+      font-family: sans-serif;
+    }
   </style>
 </head>
 <body id="canvassizer">
   <div id="mynetwork"></div>
+  <div id="toolbar">
+    <button id="toggle-mode">show tags</button>
+    <button id="merge-items">merge selected</button>
+    <button id="split-item">split selected</button>
+    <button id="move-item">move selected</button>
+    <button id="collapse-item">collapse/expand selected</button>
+    <button id="remove-redundant">remove dashed (redundant) edges</button>
+  </div>
+  <div id="history">
+    <input type="range" id="history-slider" min="0" max="0" value="0" />
+    <span id="history-label">now</span>
+  </div>
+  <div id="breadcrumb"></div>
+  <div id="legend"></div>
   <script type="text/javascript" src="/static/prioritize.js"></script>
 </body>
 </html>
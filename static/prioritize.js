@@ -17,6 +17,22 @@
   // create a network
   var container = document.getElementById('mynetwork');
 
+  // "item" shows the item graph, "tag" the tag graph
+  var mode = "item";
+
+  // name of the item the view is focused on, see focusOn
+  var focus = null;
+
+  // hop limits for the dependencies (up) and dependents (down) of the focused item
+  var focusHops = {up: 2, down: 2};
+
+  // names of the parent items whose descendants are hidden
+  var collapsed = {};
+
+  // times of the snapshots, at is the one that is shown, null shows the current state
+  var snapshots = [];
+  var at = null;
+
   /* locales: locales, */
   var options = {
     autoResize: true,
@@ -82,7 +98,7 @@
           nodeData.label = newname;
           jQuery.ajax({
             method: "PUT",
-            url: "/item/put",
+            url: "/" + mode + "/put",
             data: JSON.stringify({
               "Name": newname
             }),
@@ -106,7 +122,7 @@
 
         jQuery.ajax({
           method: "PUT",
-          url: "/item/put-edge",
+          url: "/" + mode + "/put-edge",
           data: JSON.stringify({
             "From": fromName,
             "To": toName,
@@ -120,16 +136,34 @@
       deleteNode: function(deleteArr, callback) {
         //console.log(deleteArr.nodes[0]);
         var nodeName = network.body.nodes[deleteArr.nodes[0]].labelModule.nodeOptions.label;
-        jQuery.ajax({
-          method: "DELETE",
-          url: "/item/remove",
-          data: JSON.stringify({
-            "Name": nodeName
-          }),
-          contentType: "application/json; charset=UTF-8",
-          success: function(){ 
-            callback();
-            getData(); }
+        var remove = function() {
+          jQuery.ajax({
+            method: "DELETE",
+            url: "/" + mode + "/remove",
+            data: JSON.stringify({
+              "Name": nodeName
+            }),
+            contentType: "application/json; charset=UTF-8",
+            success: function(){ 
+              callback();
+              getData(); }
+          });
+        };
+
+        if (mode !== "item") {
+          remove();
+          return;
+        }
+
+        // the rank changes follow the ranking of the page (?rank=...)
+        var query = window.location.search;
+        query += (query ? "&" : "?") + jQuery.param({name: nodeName});
+        jQuery.getJSON("/item/impact" + query, function(impact) {
+          if (confirm(impactSummary(impact))) {
+            remove();
+          } else {
+            callback(null);
+          }
         });
       },
       deleteEdge: function(deleteArr, callback) {
@@ -140,7 +174,7 @@
         var nodeTo = network.body.nodes[edge.toId].labelModule.nodeOptions.label;
         jQuery.ajax({
           method: "DELETE",
-          url: "/item/remove-edge",
+          url: "/" + mode + "/remove-edge",
           data: JSON.stringify({
             "From": nodeFrom,
             "To": nodeTo
@@ -159,7 +193,7 @@
         if (newname && newname != nodeData.label) {
           jQuery.ajax({
             method: "PATCH",
-            url: "/item/rename",
+            url: "/" + mode + "/rename",
             data: JSON.stringify({
               "Old": nodeData.label,
               "New": newname,
@@ -177,43 +211,15 @@
     },
     interaction: {
       dragNodes: true,
+      multiselect: true,
       keyboard: {
         enabled: true,
         bindToWindow: true
       }
     },
+    // the colors of the groups come with the dataset, see getData
     groups:{
-      useDefaultGroups: true,
-      group0:{
-        color: "lightgray"
-      },
-      group1:{
-        color: "black",
-        font: {
-          color: "white"
-        } 
-      },
-      group2:{
-        color: "green",
-        font: {
-          color: "white"
-        }
-      },
-      group3:{
-        color: "yellow"
-      },
-      group4:{
-        color: "blue",
-        font: {
-          color: "white"
-        } 
-      },
-      group5:{
-        color: "red",
-        font: {
-          color: "white"
-        } 
-      }
+      useDefaultGroups: true
     }
   };
   /*,
@@ -228,17 +234,287 @@
   */
   var network = new vis.Network(container, {nodes: [], edges: []}, options);
 
+  // query for the dataset, passes filters like ?attr=owner:alice&groupby=component through
+  function visQuery() {
+    var query = window.location.search;
+    if (mode === "item" && focus !== null) {
+      query += (query ? "&" : "?") + jQuery.param({focus: focus, up: focusHops.up, down: focusHops.down});
+    }
+    if (mode === "item") {
+      jQuery.each(collapsed, function(name) {
+        query += (query ? "&" : "?") + jQuery.param({collapse: name});
+      });
+    }
+    if (at !== null) {
+      query += (query ? "&" : "?") + jQuery.param({at: at});
+    }
+    return query;
+  }
+
   function getData(callback) {
-    jQuery.getJSON("/item/vis", function(data){
+    jQuery.getJSON("/" + mode + "/vis" + visQuery(), function(data){
       console.log(data);
+      network.setOptions({groups: data.groups});
       network.setData(data);
       network.redraw();  
+      showLegend(data.legend);
       if (callback) {
         callback();
       }
     });
   }
 
+  // text for the confirmation before removing an item
+  function impactSummary(impact) {
+    var lines = ["Remove " + impact.Item + "?"];
+    var list = function(label, names) {
+      if (names && names.length > 0) {
+        lines.push(label + ": " + names.join(", "));
+      }
+    };
+    list("dependent items", impact.Dependents);
+    list("would become ready", impact.Ready);
+    list("would be orphaned", impact.Orphaned);
+    jQuery.each(impact.RankChanges || [], function(i, c) {
+      if (c.Before > 0 && c.After > 0) {
+        lines.push(c.Name + " moves from #" + c.Before + " to #" + c.After);
+      }
+    });
+    return lines.join("\n");
+  }
+
+  // describes what each color means
+  function showLegend(legend) {
+    var el = jQuery("#legend");
+    el.empty();
+    jQuery.each(legend || [], function(i, entry) {
+      jQuery("<div>")
+        .addClass("legend-entry")
+        .css({"background-color": entry.Color, "color": entry.FontColor || "black"})
+        .text(entry.Label)
+        .appendTo(el);
+    });
+  }
+
+  // switches between the item graph and the tag graph,
+  // the nodes of the tag graph are sized by the number of items carrying the tag
+  jQuery("#toggle-mode").click(function() {
+    mode = mode === "item" ? "tag" : "item";
+    jQuery("#breadcrumb").toggle(mode === "item");
+    jQuery(this).text(mode === "item" ? "show tags" : "show items");
+    network.setOptions({nodes: {scaling: {label: {enabled: mode === "tag"}}}});
+    getData();
+  });
+
+  // shows only the neighbourhood of the item of the given name, null shows the full graph
+  function focusOn(name) {
+    focus = name;
+    var crumbs = jQuery("#breadcrumb");
+    crumbs.empty();
+    if (focus !== null) {
+      jQuery("<a href='#'>").text("all items").click(function(ev) {
+        ev.preventDefault();
+        focusOn(null);
+      }).appendTo(crumbs);
+      jQuery("<span>").text(" › " + focus).appendTo(crumbs);
+    }
+    getData();
+  }
+
+  // the slider scrubs through the snapshots, its rightmost position is the current state
+  function loadHistory() {
+    jQuery.getJSON("/history", function(times) {
+      snapshots = times;
+      var slider = jQuery("#history-slider");
+      slider.attr("max", snapshots.length);
+      if (at === null) {
+        slider.val(snapshots.length);
+      }
+    });
+  }
+
+  jQuery("#history-slider").on("mousedown", loadHistory).on("input change", function() {
+    var i = parseInt(jQuery(this).val(), 10);
+    at = i < snapshots.length ? snapshots[i] : null;
+    jQuery("#history-label").text(at === null ? "now" : new Date(at).toLocaleString());
+    // the past can't be edited
+    network.setOptions({manipulation: {enabled: at === null}});
+    getData();
+  });
+
+  loadHistory();
+
+  // merges the second selected item into the first one
+  jQuery("#merge-items").click(function() {
+    var selected = network.getSelectedNodes();
+    if (mode !== "item" || selected.length !== 2) {
+      alert("select exactly two items (hold ctrl) to merge them");
+      return;
+    }
+    var keep = network.body.nodes[selected[0]].labelModule.nodeOptions.label;
+    var drop = network.body.nodes[selected[1]].labelModule.nodeOptions.label;
+    if (!confirm("Merge " + drop + " into " + keep + "?")) {
+      return;
+    }
+    jQuery.ajax({
+      method: "POST",
+      url: "/item/merge",
+      data: JSON.stringify({
+        "Keep": keep,
+        "Drop": drop
+      }),
+      contentType: "application/json; charset=UTF-8",
+      success: function(res) {
+        if (res.Cycles && res.Cycles.length > 0) {
+          alert("the merge created dependency cycles:\n" + jQuery.map(res.Cycles, function(c) {
+            return c.join(" <-> ");
+          }).join("\n"));
+        }
+        getData();
+      },
+      error: function(xhr) {
+        alert(xhr.responseText);
+      }
+    });
+  });
+
+  // splits the selected item into several new items, asking for the names of the parts
+  // and the dependencies each part takes over. All dependents depend on all parts afterwards.
+  jQuery("#split-item").click(function() {
+    var selected = network.getSelectedNodes();
+    if (mode !== "item" || selected.length !== 1) {
+      alert("select exactly one item to split it");
+      return;
+    }
+    var name = network.body.nodes[selected[0]].labelModule.nodeOptions.label;
+    var names = prompt("Split " + name + " into (comma separated names):", "");
+    if (!names) {
+      return;
+    }
+
+    var dependencies = [];
+    jQuery.each(network.body.edges, function(id, edge) {
+      if (edge.fromId === selected[0]) {
+        dependencies.push(network.body.nodes[edge.toId].labelModule.nodeOptions.label);
+      }
+    });
+
+    var parts = [];
+    jQuery.each(names.split(","), function(i, partName) {
+      partName = jQuery.trim(partName);
+      if (!partName) {
+        return;
+      }
+      var part = {"Name": partName, "DependsOn": []};
+      if (dependencies.length > 0) {
+        var deps = prompt("Dependencies of " + partName + " (comma separated):", dependencies.join(", "));
+        jQuery.each((deps || "").split(","), function(j, dep) {
+          dep = jQuery.trim(dep);
+          if (dep) {
+            part.DependsOn.push(dep);
+          }
+        });
+      }
+      parts.push(part);
+    });
+
+    jQuery.ajax({
+      method: "POST",
+      url: "/item/split",
+      data: JSON.stringify({
+        "Name": name,
+        "Parts": parts
+      }),
+      contentType: "application/json; charset=UTF-8",
+      success: function() {
+        getData();
+      },
+      error: function(xhr) {
+        alert(xhr.responseText);
+      }
+    });
+  });
+
+  // makes the selected item a child of another item (the epic it is part of)
+  jQuery("#move-item").click(function() {
+    var selected = network.getSelectedNodes();
+    if (mode !== "item" || selected.length !== 1) {
+      alert("select exactly one item to move it");
+      return;
+    }
+    var name = network.body.nodes[selected[0]].labelModule.nodeOptions.label;
+    var parent = prompt("Move " + name + " into (empty for top level):", "");
+    if (parent === null) {
+      return;
+    }
+    jQuery.ajax({
+      method: "POST",
+      url: "/item/move",
+      data: JSON.stringify({
+        "Name": name,
+        "Parent": jQuery.trim(parent)
+      }),
+      contentType: "application/json; charset=UTF-8",
+      success: function() {
+        getData();
+      },
+      error: function(xhr) {
+        alert(xhr.responseText);
+      }
+    });
+  });
+
+  // hides or shows the descendants of the selected parent item
+  jQuery("#collapse-item").click(function() {
+    var selected = network.getSelectedNodes();
+    if (mode !== "item" || selected.length !== 1) {
+      alert("select exactly one parent item to collapse or expand it");
+      return;
+    }
+    var name = network.body.nodes[selected[0]].labelModule.nodeOptions.label;
+    if (collapsed[name]) {
+      delete collapsed[name];
+    } else {
+      collapsed[name] = true;
+    }
+    getData();
+  });
+
+  jQuery("#remove-redundant").click(function() {
+    if (mode !== "item") {
+      return;
+    }
+    jQuery.getJSON("/item/redundant-edges", function(edges) {
+      if (edges.length === 0) {
+        alert("there are no redundant edges");
+        return;
+      }
+      var list = edges.map(function(e) {
+        return e.From + " -> " + e.To;
+      });
+      if (!confirm("Remove " + edges.length + " redundant edges?\n\n" + list.join("\n"))) {
+        return;
+      }
+      jQuery.ajax({
+        method: "DELETE",
+        url: "/item/redundant-edges",
+        success: function() {
+          getData();
+        },
+        error: function(xhr) {
+          alert(xhr.responseText);
+        }
+      });
+    });
+  });
+
+  network.on("doubleClick", function(params) {
+    if (mode !== "item" || params.nodes.length === 0) {
+      return;
+    }
+    focusOn(network.body.nodes[params.nodes[0]].labelModule.nodeOptions.label);
+  });
+
   getData();
 
   jQuery.getJSON("/app/name", function(data) {